@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// dnAuthConfig lets a load balancer that terminates mTLS and injects a
+// client-certificate DN header stand in for Slack's HMAC signature
+// check, for deployments where that header is already a trusted
+// boundary.
+type dnAuthConfig struct {
+	header  string
+	pattern *regexp.Regexp
+}
+
+var dnAuth *dnAuthConfig
+
+// ConfigureClientDNAuth enables the mTLS / header-based authentication
+// short-circuit in verifyWebHook: if headerName is present on a request
+// and its value matches dnRegex, the request is trusted without
+// checking Slack's HMAC signature. An empty headerName disables the
+// short-circuit, which is the default. Call this once at startup.
+func ConfigureClientDNAuth(headerName, dnRegex string) error {
+	if headerName == "" {
+		dnAuth = nil
+		return nil
+	}
+
+	pattern, err := regexp.Compile(dnRegex)
+	if err != nil {
+		return fmt.Errorf("regexp.Compile(%q): %v", dnRegex, err)
+	}
+
+	dnAuth = &dnAuthConfig{header: headerName, pattern: pattern}
+	return nil
+}
+
+// verifiedByClientDN reports whether r carries a client-cert DN header
+// matching the pattern configured via ConfigureClientDNAuth.
+func verifiedByClientDN(r *http.Request) bool {
+	if dnAuth == nil {
+		return false
+	}
+
+	dn := r.Header.Get(dnAuth.header)
+	if dn == "" {
+		return false
+	}
+
+	return dnAuth.pattern.MatchString(dn)
+}
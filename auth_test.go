@@ -0,0 +1,112 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifiedByClientDN(t *testing.T) {
+	defer ConfigureClientDNAuth("", "")
+
+	if err := ConfigureClientDNAuth("X-Client-DN", `^CN=slack\.example\.com,`); err != nil {
+		t.Fatalf("ConfigureClientDNAuth: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Client-DN", "CN=slack.example.com,O=Example Corp")
+	if !verifiedByClientDN(r) {
+		t.Error("verifiedByClientDN = false, want true for a matching DN")
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Client-DN", "CN=attacker.example.com,O=Example Corp")
+	if verifiedByClientDN(r) {
+		t.Error("verifiedByClientDN = true, want false for a non-matching DN")
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	if verifiedByClientDN(r) {
+		t.Error("verifiedByClientDN = true, want false when the header is absent")
+	}
+}
+
+func TestVerifiedByClientDNDisabledByDefault(t *testing.T) {
+	defer ConfigureClientDNAuth("", "")
+	ConfigureClientDNAuth("", "")
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Client-DN", "CN=slack.example.com,O=Example Corp")
+	if verifiedByClientDN(r) {
+		t.Error("verifiedByClientDN = true, want false when ConfigureClientDNAuth has not been called with a header")
+	}
+}
+
+func TestConfigureClientDNAuthRejectsBadRegex(t *testing.T) {
+	defer ConfigureClientDNAuth("", "")
+
+	if err := ConfigureClientDNAuth("X-Client-DN", "("); err == nil {
+		t.Error("ConfigureClientDNAuth(..., \"(\") = nil error, want a compile error")
+	}
+}
+
+// TestVerifyWebHookClientDNBypassesSignatureCheck exercises verifyWebHook
+// itself (rather than verifiedByClientDN directly) to prove the DN
+// short-circuit at the top of verifyWebHook actually skips HMAC
+// verification end-to-end, regardless of whether the signature headers
+// would otherwise have passed or failed.
+func TestVerifyWebHookClientDNBypassesSignatureCheck(t *testing.T) {
+	defer ConfigureClientDNAuth("", "")
+
+	if err := ConfigureClientDNAuth("X-Client-DN", `^CN=slack\.example\.com,`); err != nil {
+		t.Fatalf("ConfigureClientDNAuth: %v", err)
+	}
+
+	const secret = "shhh"
+	const body = "token=abc"
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("X-Client-DN", "CN=slack.example.com,O=Example Corp")
+		return r
+	}
+
+	r := newRequest()
+	r.Header.Set(slackRequestTimestampHeader, "1")
+	r.Header.Set(slackSignatureHeader, "v0=deadbeef")
+	ok, err := verifyWebHook(r, secret)
+	if err != nil || !ok {
+		t.Errorf("verifyWebHook with a bad signature = %v, %v; want true, nil", ok, err)
+	}
+
+	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
+	baseString := fmt.Sprintf("%s:%s:%s", version, timeStamp, body)
+	signature := hex.EncodeToString(getSignature([]byte(baseString), []byte(secret)))
+
+	r = newRequest()
+	r.Header.Set(slackRequestTimestampHeader, timeStamp)
+	r.Header.Set(slackSignatureHeader, fmt.Sprintf("%s=%s", version, signature))
+	ok, err = verifyWebHook(r, secret)
+	if err != nil || !ok {
+		t.Errorf("verifyWebHook with a valid signature = %v, %v; want true, nil", ok, err)
+	}
+}
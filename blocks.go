@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+// Block Kit action identifiers dispatched by the /interactivity route.
+// See https://api.slack.com/block-kit/interactivity.
+const (
+	actionCloseTask = "close_task"
+	actionClaimTask = "claim_task"
+	actionNextPage  = "next_page"
+)
+
+// blockText is a Slack Block Kit text composition object.
+// See https://api.slack.com/reference/block-kit/composition-objects#text.
+type blockText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// button is a Block Kit interactive button element. Value round-trips
+// whatever the action needs to operate (e.g. a maniphest ID), since
+// Slack gives it back verbatim on the resulting interaction payload.
+type button struct {
+	Type     string    `json:"type"`
+	Text     blockText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+	Style    string    `json:"style,omitempty"`
+}
+
+// block is a single Block Kit layout block. Only the fields used by this
+// package are modeled; unused block types (image, context, ...) are left
+// out rather than modeling the full Block Kit schema.
+type block struct {
+	Type     string     `json:"type"`
+	Text     *blockText `json:"text,omitempty"`
+	Elements []button   `json:"elements,omitempty"`
+}
+
+// newSectionBlock renders a markdown section block, the Block Kit
+// equivalent of attachment.Text.
+func newSectionBlock(markdown string) block {
+	return block{
+		Type: "section",
+		Text: &blockText{Type: "mrkdwn", Text: markdown},
+	}
+}
+
+// newTaskActionsBlock renders the "Close Task" / "Claim Task" button row
+// attached to a maniphest task lookup. value is the bare maniphest ID
+// (e.g. "123") and is echoed back on the action payload.
+//
+// There is no "Comment" button here: replying to a Slack message isn't
+// enough to drive a maniphest.edit comment transaction without a modal
+// (views.open) or an Events API message handler to receive the
+// follow-up, neither of which this package implements yet. Add it back
+// once one of those exists.
+func newTaskActionsBlock(value string) block {
+	return block{
+		Type: "actions",
+		Elements: []button{
+			{
+				Type:     "button",
+				Text:     blockText{Type: "plain_text", Text: "Close Task"},
+				ActionID: actionCloseTask,
+				Value:    value,
+				Style:    "danger",
+			},
+			{
+				Type:     "button",
+				Text:     blockText{Type: "plain_text", Text: "Claim Task"},
+				ActionID: actionClaimTask,
+				Value:    value,
+				Style:    "primary",
+			},
+		},
+	}
+}
+
+// newPaginationBlock renders a single "Next" button for a paginated
+// search result. cursor is Phabricator's opaque "after" cursor for the
+// next page and is round-tripped through the action value alongside the
+// original query so the interactivity handler can re-run the search.
+func newPaginationBlock(query, cursor string) block {
+	if cursor == "" {
+		return block{}
+	}
+	return block{
+		Type: "actions",
+		Elements: []button{
+			{
+				Type:     "button",
+				Text:     blockText{Type: "plain_text", Text: "Next"},
+				ActionID: actionNextPage,
+				Value:    query + "\x1f" + cursor,
+			},
+		},
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// slackClientTimeout bounds a single chat.postMessage call, including
+// any retries performed by retryingTransport.
+const slackClientTimeout = 10 * time.Second
+
+// postMessageRequest is the request body for chat.postMessage.
+// See https://api.slack.com/methods/chat.postMessage.
+type postMessageRequest struct {
+	Channel string `json:"channel"`
+	Text    string `json:"text"`
+}
+
+// postMessageResponse is the subset of chat.postMessage's response this
+// package inspects.
+type postMessageResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// postMessage posts text to channel via chat.postMessage, authenticated
+// as the bot user behind slackBotToken.
+func postMessage(channel, text string) error {
+	body, err := json.Marshal(postMessageRequest{Channel: channel, Text: text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+slackBotToken)
+
+	client := newRetryingClient(slackClientTimeout, defaultRetryConfig)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res postMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("decoding chat.postMessage response: %v", err)
+	}
+	if !res.OK {
+		return fmt.Errorf("chat.postMessage: %s", res.Error)
+	}
+	return nil
+}
@@ -10,7 +10,13 @@ import (
 )
 
 func main() {
+	if err := slack.ConfigureClientDNAuth(os.Getenv("CLIENT_DN_HEADER"), os.Getenv("CLIENT_DN_REGEX")); err != nil {
+		log.Fatalf("slack.ConfigureClientDNAuth: %v\n", err)
+	}
+
 	funcframework.RegisterHTTPFunction("/", slack.F)
+	funcframework.RegisterHTTPFunction("/interactivity", slack.Interactivity)
+	funcframework.RegisterEventFunction("/sync-feed", slack.SyncFeed)
 	// Use PORT environment variable, or default to 8080.
 	port := "8080"
 	if envPort := os.Getenv("PORT"); envPort != "" {
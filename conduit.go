@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import "github.com/uber/gonduit"
+
+// The pinned gonduit v0.6.1 has no typed wrapper for several Conduit
+// methods this package needs: project.search (here), plus
+// differential.revision.search, paste.search and user.search
+// (search.go) and maniphest.edit and feed.query (interactivity.go,
+// feed.go). Each of those hand-rolls its own request/response shapes
+// and calls the method through the generic Conn.Call, gonduit's escape
+// hatch for endpoints it doesn't otherwise model, rather than repeating
+// this explanation at every call site.
+//
+// project.search backs search.go's "#tag" lookup and feed.go's story ->
+// project routing.
+// See https://phabricator.sirclo.com/conduit/method/project.search/.
+
+type projectSearchConstraints struct {
+	Slugs []string `json:"slugs,omitempty"`
+	PHIDs []string `json:"phids,omitempty"`
+}
+
+type projectSearchRequest struct {
+	Constraints *projectSearchConstraints `json:"constraints,omitempty"`
+}
+
+type projectSearchResponseItem struct {
+	ID     int    `json:"id"`
+	PHID   string `json:"phid"`
+	Fields struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"fields"`
+}
+
+type projectSearchResponse struct {
+	Data []projectSearchResponseItem `json:"data"`
+}
+
+// searchProjects calls project.search with constraints.
+func searchProjects(client *gonduit.Conn, constraints projectSearchConstraints) ([]projectSearchResponseItem, error) {
+	req := projectSearchRequest{Constraints: &constraints}
+
+	var res projectSearchResponse
+	if err := client.Call("project.search", req, &res); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
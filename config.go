@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// channelRoute maps a single Phabricator project slug (tag) to the
+// Slack channel SyncFeed should post that project's feed stories to.
+type channelRoute struct {
+	Tag     string `json:"tag"`
+	Channel string `json:"channel"`
+}
+
+// loadChannelRoutes parses the FEED_CHANNEL_CONFIG environment
+// variable, a JSON array of channelRoute, into a tag -> channel lookup.
+// An unset or empty variable yields no routes, so SyncFeed harmlessly
+// drops every story instead of failing.
+func loadChannelRoutes() (map[string]string, error) {
+	raw := os.Getenv("FEED_CHANNEL_CONFIG")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var routes []channelRoute
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(FEED_CHANNEL_CONFIG): %v", err)
+	}
+
+	byTag := make(map[string]string, len(routes))
+	for _, route := range routes {
+		byTag[route.Tag] = route.Channel
+	}
+	return byTag, nil
+}
+
+// userPHIDMapping maps a single Slack user to the Phabricator account
+// it should act as for interactive actions (e.g. claimTask).
+type userPHIDMapping struct {
+	SlackUserID     string `json:"slack_user_id"`
+	PhabricatorPHID string `json:"phabricator_phid"`
+}
+
+// loadUserPHIDMap parses the SLACK_USER_PHID_MAP environment variable,
+// a JSON array of userPHIDMapping, into a Slack user ID -> Phabricator
+// PHID lookup. An unset or empty variable, or a Slack user missing from
+// the map, means no mapping is available; callers fall back to
+// whichever account is appropriate for them (e.g. the one behind
+// phabAPIToken).
+func loadUserPHIDMap() (map[string]string, error) {
+	raw := os.Getenv("SLACK_USER_PHID_MAP")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var mappings []userPHIDMapping
+	if err := json.Unmarshal([]byte(raw), &mappings); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(SLACK_USER_PHID_MAP): %v", err)
+	}
+
+	byUser := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		byUser[m.SlackUserID] = m.PhabricatorPHID
+	}
+	return byUser, nil
+}
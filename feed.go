@@ -0,0 +1,265 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/uber/gonduit"
+	"github.com/uber/gonduit/core"
+	"github.com/uber/gonduit/requests"
+)
+
+// PubSubMessage is the payload Cloud Pub/Sub delivers to a background
+// function. Cloud Scheduler drives SyncFeed on a fixed cadence by
+// publishing an (empty) message to the topic it's subscribed to, so the
+// message body itself carries nothing SyncFeed needs.
+type PubSubMessage struct {
+	Data []byte `json:"data"`
+}
+
+// feedQueryLimit bounds a single feed.query page, so a sync that has
+// fallen far behind the watermark (e.g. after downtime) makes partial
+// progress and catches up over subsequent scheduled runs instead of
+// paginating within one invocation.
+const feedQueryLimit = 100
+
+// feedStory is the subset of a feed.query story this package uses,
+// assembled from two feed.query views: the "data" view carries
+// chronologicalKey/epoch/objectPHID but no rendered text, and the
+// "text" view is a bare map of chronologicalKey to rendered string with
+// none of the other fields. requestFeedSince calls both and joins them
+// on chronologicalKey.
+// See https://secure.phabricator.com/book/phabcontrib/article/conduit/.
+type feedStory struct {
+	ChronologicalKey string `json:"chronologicalKey"`
+	Epoch            int64  `json:"epoch"`
+	ObjectPHID       string `json:"objectPHID"`
+	// Text is Phabricator's own rendering of the story (e.g. "alice
+	// created T123: Fix the thing.", "bob requested review of D45."),
+	// pulled from the "text" view so SyncFeed doesn't have to
+	// reimplement per-story-type formatting.
+	Text string
+}
+
+// feedDataStory is the shape of a single entry returned by feed.query's
+// "data" view.
+type feedDataStory struct {
+	ChronologicalKey string `json:"chronologicalKey"`
+	Epoch            int64  `json:"epoch"`
+	ObjectPHID       string `json:"objectPHID"`
+}
+
+// SyncFeed is a background Cloud Function invoked by Cloud Scheduler via
+// Pub/Sub. Each run pulls every Phabricator feed story since the last
+// watermark, posts one to each Slack channel its tagged project(s) are
+// routed to, and advances the watermark only once every post for that
+// story has succeeded - so a Pub/Sub retry after a partial failure
+// resumes from the last fully-delivered story instead of skipping or
+// re-posting the rest.
+func SyncFeed(ctx context.Context, _ PubSubMessage) error {
+	setup(ctx)
+
+	routes, err := loadChannelRoutes()
+	if err != nil {
+		return fmt.Errorf("loadChannelRoutes: %v", err)
+	}
+
+	store, err := newWatermarkStore(ctx, gcpProjectID)
+	if err != nil {
+		return fmt.Errorf("newWatermarkStore: %v", err)
+	}
+	defer store.Close()
+
+	since, err := store.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("watermarkStore.Get: %v", err)
+	}
+
+	client, err := gonduit.Dial(
+		"https://phabricator.sirclo.com",
+		&core.ClientOptions{
+			APIToken: phabAPIToken,
+			Client:   newRetryingClient(phabClientTimeout, defaultRetryConfig),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("gonduit.Dial: %v", err)
+	}
+
+	stories, err := requestFeedSince(client, since)
+	if err != nil {
+		return fmt.Errorf("requestFeedSince: %v", err)
+	}
+
+	for _, story := range stories {
+		for _, channel := range channelsFor(client, story, routes) {
+			if err := postMessage(channel, story.Text); err != nil {
+				return fmt.Errorf("postMessage(%s): %v", channel, err)
+			}
+		}
+
+		if err := store.Advance(ctx, story.ChronologicalKey); err != nil {
+			return fmt.Errorf("watermarkStore.Advance: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// requestFeedSince calls feed.query for every story published after the
+// watermark, oldest first. gonduit has no typed feed.query wrapper, so
+// this goes through Conn.Call (see conduit.go), once for the "data"
+// view (chronologicalKey/epoch/objectPHID) and once for the "text"
+// view (Phabricator's own rendering, returned bare with no other
+// fields) - there's no single view that returns both.
+func requestFeedSince(client *gonduit.Conn, after string) ([]feedStory, error) {
+	params := map[string]interface{}{
+		"limit": feedQueryLimit,
+	}
+	if after != "" {
+		params["after"] = after
+	}
+
+	dataParams := map[string]interface{}{"view": "data"}
+	for k, v := range params {
+		dataParams[k] = v
+	}
+	var data map[string]feedDataStory
+	if err := client.Call("feed.query", dataParams, &data); err != nil {
+		return nil, err
+	}
+
+	textParams := map[string]interface{}{"view": "text"}
+	for k, v := range params {
+		textParams[k] = v
+	}
+	var text map[string]string
+	if err := client.Call("feed.query", textParams, &text); err != nil {
+		return nil, err
+	}
+
+	stories := make([]feedStory, 0, len(data))
+	for key, d := range data {
+		stories = append(stories, feedStory{
+			ChronologicalKey: d.ChronologicalKey,
+			Epoch:            d.Epoch,
+			ObjectPHID:       d.ObjectPHID,
+			Text:             text[key],
+		})
+	}
+	// Sort by ChronologicalKey rather than Epoch: it's the precise,
+	// strictly-ordered cursor feed.query itself uses for "after", while
+	// Epoch only has second resolution and ties within it would leave
+	// the posting order - and therefore the watermark - ambiguous.
+	// ChronologicalKey is a large integer encoded as a string, so it's
+	// parsed before comparing rather than compared lexicographically -
+	// string comparison only agrees with numeric order while every key
+	// has the same digit count.
+	sort.Slice(stories, func(i, j int) bool {
+		return chronologicalKeyLess(stories[i].ChronologicalKey, stories[j].ChronologicalKey)
+	})
+
+	// Belt-and-suspenders against feed.query's "after" cursor direction:
+	// Phabricator's own docs don't pin down whether "after" means
+	// strictly newer than the given key or is a plain pagination
+	// continuation (which, since feed.query lists newest-first by
+	// default, could mean older). Dropping anything at or before the
+	// watermark keeps the sync idempotent and forward-only even if that
+	// assumption turns out to be wrong - worst case a run makes no
+	// progress instead of re-posting or walking the watermark
+	// backwards. Confirm the real direction against
+	// https://phabricator.sirclo.com/conduit/method/feed.query/ before
+	// relying on "after" alone to bound the result set.
+	if after != "" {
+		stories = dropThroughWatermark(stories, after)
+	}
+	return stories, nil
+}
+
+// dropThroughWatermark returns the stories in stories whose
+// ChronologicalKey sorts strictly after watermark.
+func dropThroughWatermark(stories []feedStory, watermark string) []feedStory {
+	filtered := stories[:0]
+	for _, story := range stories {
+		if chronologicalKeyLess(watermark, story.ChronologicalKey) {
+			filtered = append(filtered, story)
+		}
+	}
+	return filtered
+}
+
+// chronologicalKeyLess reports whether a sorts before b as the big
+// integers they encode. feed.query's chronologicalKey can exceed the
+// range of an int64, so both sides are parsed with math/big rather than
+// strconv.
+func chronologicalKeyLess(a, b string) bool {
+	ai, aok := new(big.Int).SetString(a, 10)
+	bi, bok := new(big.Int).SetString(b, 10)
+	if !aok || !bok {
+		return a < b
+	}
+	return ai.Cmp(bi) < 0
+}
+
+// channelsFor resolves the Slack channels story should be posted to, by
+// looking up the Phabricator projects its object is tagged with and
+// mapping each to a channel via routes.
+func channelsFor(client *gonduit.Conn, story feedStory, routes map[string]string) []string {
+	if len(routes) == 0 {
+		return nil
+	}
+
+	var channels []string
+	for _, tag := range projectTagsFor(client, story.ObjectPHID) {
+		if channel, ok := routes[tag]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// projectTagsFor returns the slugs of every project objectPHID is
+// tagged with. Only maniphest tasks are resolved this way; any other
+// object type, or a lookup error, yields no projects rather than
+// failing the sync - a story SyncFeed can't route is simply dropped.
+func projectTagsFor(client *gonduit.Conn, objectPHID string) []string {
+	res, err := client.ManiphestSearch(requests.ManiphestSearchRequest{
+		Constraints: &requests.ManiphestSearchConstraints{PHIDs: []string{objectPHID}},
+		Attachments: &requests.ManiphestSearchAttachments{Projects: true},
+	})
+	if err != nil || len(res.Data) == 0 {
+		return nil
+	}
+
+	projectPHIDs := res.Data[0].Attachments.Projects.ProjectPHIDs
+	if len(projectPHIDs) == 0 {
+		return nil
+	}
+
+	projects, err := searchProjects(client, projectSearchConstraints{PHIDs: projectPHIDs})
+	if err != nil {
+		return nil
+	}
+
+	tags := make([]string, 0, len(projects))
+	for _, p := range projects {
+		tags = append(tags, p.Fields.Slug)
+	}
+	return tags
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/gonduit"
+	"github.com/uber/gonduit/core"
+)
+
+// newFakeConduitServer stands in for Phabricator's Conduit endpoint: it
+// satisfies conduit.getcapabilities for gonduit.Dial, and routes
+// feed.query calls to handleFeedQuery based on the "view" parameter
+// gonduit sends in the urlencoded "params" form field.
+func newFakeConduitServer(t *testing.T, dataResult, textResult interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+
+		switch r.URL.Path {
+		case "/api/conduit.getcapabilities":
+			writeConduitResult(w, map[string]interface{}{
+				"authentication": []string{"token"},
+				"input":          []string{"urlencoded"},
+				"output":         []string{"json"},
+			})
+		case "/api/feed.query":
+			var params map[string]interface{}
+			if err := json.Unmarshal([]byte(r.Form.Get("params")), &params); err != nil {
+				t.Fatalf("unmarshal params: %v", err)
+			}
+			switch params["view"] {
+			case "data":
+				writeConduitResult(w, dataResult)
+			case "text":
+				writeConduitResult(w, textResult)
+			default:
+				t.Fatalf("feed.query called without a view: %v", params)
+			}
+		default:
+			t.Fatalf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+}
+
+func writeConduitResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error_code": nil})
+}
+
+func dialFakeConn(t *testing.T, server *httptest.Server) *gonduit.Conn {
+	client, err := gonduit.Dial(server.URL, &core.ClientOptions{APIToken: "fake-token"})
+	if err != nil {
+		t.Fatalf("gonduit.Dial: %v", err)
+	}
+	return client
+}
+
+func TestRequestFeedSinceJoinsDataAndTextViews(t *testing.T) {
+	data := map[string]interface{}{
+		"1": map[string]interface{}{"chronologicalKey": "1", "epoch": 100, "objectPHID": "PHID-TASK-1"},
+		"2": map[string]interface{}{"chronologicalKey": "2", "epoch": 200, "objectPHID": "PHID-TASK-2"},
+	}
+	text := map[string]interface{}{
+		"1": "alice created T1: First.",
+		"2": "bob created T2: Second.",
+	}
+
+	server := newFakeConduitServer(t, data, text)
+	defer server.Close()
+	client := dialFakeConn(t, server)
+
+	stories, err := requestFeedSince(client, "")
+	if err != nil {
+		t.Fatalf("requestFeedSince: %v", err)
+	}
+	if len(stories) != 2 {
+		t.Fatalf("got %d stories, want 2", len(stories))
+	}
+	if stories[0].ChronologicalKey != "1" || stories[0].Text != "alice created T1: First." {
+		t.Errorf("stories[0] = %+v, want chronologicalKey 1 with its joined text", stories[0])
+	}
+	if stories[1].ChronologicalKey != "2" || stories[1].Text != "bob created T2: Second." {
+		t.Errorf("stories[1] = %+v, want chronologicalKey 2 with its joined text", stories[1])
+	}
+}
+
+// TestRequestFeedSinceDropsStoriesAtOrBeforeWatermark guards the sync
+// against feed.query's "after" cursor turning out to include the
+// watermark itself or anything older than it - whether because "after"
+// is inclusive, or because its pagination direction isn't what
+// requestFeedSince assumes. Without this, SyncFeed would either re-post
+// the watermark story forever or walk the watermark backwards.
+func TestRequestFeedSinceDropsStoriesAtOrBeforeWatermark(t *testing.T) {
+	data := map[string]interface{}{
+		"5": map[string]interface{}{"chronologicalKey": "5", "epoch": 500, "objectPHID": "PHID-TASK-OLD"},
+		"6": map[string]interface{}{"chronologicalKey": "6", "epoch": 600, "objectPHID": "PHID-TASK-NEW"},
+	}
+	text := map[string]interface{}{
+		"5": "this is at the watermark and must not resurface",
+		"6": "this is newer than the watermark",
+	}
+
+	server := newFakeConduitServer(t, data, text)
+	defer server.Close()
+	client := dialFakeConn(t, server)
+
+	stories, err := requestFeedSince(client, "5")
+	if err != nil {
+		t.Fatalf("requestFeedSince: %v", err)
+	}
+	if len(stories) != 1 || stories[0].ChronologicalKey != "6" {
+		t.Fatalf("requestFeedSince(after=5) = %+v, want only chronologicalKey 6", stories)
+	}
+}
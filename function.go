@@ -26,7 +26,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -71,55 +70,93 @@ type fields struct {
 type Message struct {
 	ResponseType string       `json:"response_type"`
 	Text         string       `json:"text"`
-	Attachments  []attachment `json:"attachments"`
+	Attachments  []attachment `json:"attachments,omitempty"`
+	// Blocks carries a Block Kit rendering of the same message, used to
+	// attach interactive elements (buttons, pagination). Slack clients
+	// that understand blocks render these in place of Attachments.
+	// See https://api.slack.com/block-kit.
+	Blocks []block `json:"blocks,omitempty"`
 }
 
 // F uses the Knowledge Graph API to search for a query provided
 // by a Slack command.
 func F(w http.ResponseWriter, r *http.Request) {
-	setup(r.Context())
+	start := time.Now()
+	ctx := r.Context()
+	setup(ctx)
+
+	var rf requestFields
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Fatalf("Couldn't read request body: %v", err)
+		writeError(ctx, w, rf, start, "Couldn't read request body", err)
+		return
 	}
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	if r.Method != "POST" {
 		http.Error(w, "Only POST requests are accepted", 405)
+		return
 	}
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Couldn't parse form", 400)
-		log.Fatalf("ParseForm: %v", err)
+		writeError(ctx, w, rf, start, "Couldn't parse form", err)
+		return
 	}
 
 	// Reset r.Body as ParseForm depletes it by reading the io.ReadCloser.
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
+	rf.UserID = r.Form.Get("user_id")
+	rf.TeamID = r.Form.Get("team_id")
+	rf.Command = r.Form.Get("command")
+
 	result, err := verifyWebHook(r, slackSecret)
 	if err != nil {
-		log.Fatalf("verifyWebhook: %v", err)
+		writeError(ctx, w, rf, start, "verifyWebHook failed", err)
+		return
 	}
 	if !result {
-		log.Fatalf("signatures did not match.")
+		writeError(ctx, w, rf, start, "signatures did not match", nil)
+		return
 	}
 
 	if len(r.Form["text"]) == 0 {
-		log.Fatalf("empty text in form")
+		writeError(ctx, w, rf, start, "empty text in form", nil)
+		return
 	}
+	rf.Query = r.Form["text"][0]
 
-	res, err := makeSearchRequest(r.Form["text"][0])
+	res, err := makeSearchRequest(rf.Query)
 	if err != nil {
-		log.Fatalf("makeSearchRequest: %v", err)
+		writeError(ctx, w, rf, start, "makeSearchRequest failed", err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err = json.NewEncoder(w).Encode(res); err != nil {
-		log.Fatalf("json.Marshal: %v", err)
+		logRequest(ctx, rf, time.Since(start), err)
+		return
 	}
+	logRequest(ctx, rf, time.Since(start), nil)
 }
 
+// makeSearchRequest dispatches query to the Phabricator object search
+// matching its prefix (see makeSearchRequestAfter).
 func makeSearchRequest(query string) (*Message, error) {
+	return makeSearchRequestAfter(query, "")
+}
+
+// makeSearchRequestAfter dispatches query based on its leading
+// character: "T" for a maniphest task, "D" for a differential revision,
+// "P" for a paste, "@" for a user, "#" for a project, and anything else
+// falls back to a maniphest fulltext search. A leading T/D/P only counts
+// as an object reference when the remainder parses as a number (see
+// isObjectRefQuery), so free text like "test coverage" or "deploy
+// pipeline" falls through to the fulltext search instead of failing to
+// parse as an object ID. after is Phabricator's opaque search cursor
+// and only applies to the fulltext fallback, which is the only handler
+// that can return more than one result.
+func makeSearchRequestAfter(query, after string) (*Message, error) {
 
 	message := &Message{}
 
@@ -127,28 +164,48 @@ func makeSearchRequest(query string) (*Message, error) {
 		"https://phabricator.sirclo.com",
 		&core.ClientOptions{
 			APIToken: phabAPIToken,
+			Client:   newRetryingClient(phabClientTimeout, defaultRetryConfig),
 		},
 	)
 
-	ce, ok := err.(*core.ConduitError)
-	if ok {
-		log.Fatal("code: " + ce.Code())
-		log.Fatal("info: " + ce.Info())
+	if ce, ok := err.(*core.ConduitError); ok {
+		return message, fmt.Errorf("conduit error %s: %s", ce.Code(), ce.Info())
 	}
-
-	// Or, use the built-in utility function:
-	if core.IsConduitError(err) {
-		log.Fatal(err)
+	if err != nil {
 		return message, err
 	}
 
-	if strings.HasPrefix(query, "T") || strings.HasPrefix(query, "t") {
-		message, err = requestManiphestDetail(client, query)
-		if err != nil {
-			return message, err
+	switch {
+	case isObjectRefQuery(query, "T", "t"):
+		return requestManiphestDetail(client, query)
+	case isObjectRefQuery(query, "D", "d"):
+		return requestDifferentialDetail(client, query)
+	case isObjectRefQuery(query, "P", "p"):
+		return requestPasteDetail(client, query)
+	case strings.HasPrefix(query, "@"):
+		return requestUserLookup(client, query)
+	case strings.HasPrefix(query, "#"):
+		return requestProjectLookup(client, query)
+	default:
+		return requestFulltextSearch(client, query, after)
+	}
+}
+
+// isObjectRefQuery reports whether query is an object reference for one
+// of the given prefixes (e.g. "T123"), i.e. it starts with one of them
+// and the remainder parses as a number. This distinguishes object
+// references from ordinary fulltext queries that merely happen to start
+// with the same letter, such as "test coverage" or "deploy pipeline".
+func isObjectRefQuery(query string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(query, prefix) {
+			continue
+		}
+		if _, err := strconv.Atoi(query[len(prefix):]); err == nil {
+			return true
 		}
 	}
-	return message, err
+	return false
 }
 
 func requestManiphestDetail(client *gonduit.Conn, query string) (message *Message, err error) {
@@ -193,6 +250,7 @@ func requestManiphestDetail(client *gonduit.Conn, query string) (message *Messag
 		Text:         fmt.Sprintf("https://phabricator.sirclo.com/T%s", query[1:]),
 		Attachments: []attachment{
 			{
+				Color:     statusColor(res.Data[0].Fields.Status.Value),
 				Title:     fmt.Sprintf("%s", res.Data[0].Fields.Name),
 				TitleLink: fmt.Sprintf("https://phabricator.sirclo.com/T%s", query[1:]),
 				Fields: []fields{
@@ -219,6 +277,9 @@ func requestManiphestDetail(client *gonduit.Conn, query string) (message *Messag
 				},
 			},
 		},
+		Blocks: []block{
+			newTaskActionsBlock(query[1:]),
+		},
 	}
 	return message, nil
 }
@@ -226,6 +287,10 @@ func requestManiphestDetail(client *gonduit.Conn, query string) (message *Messag
 // verifyWebHook verifies the request signature.
 // See https://api.slack.com/docs/verifying-requests-from-slack.
 func verifyWebHook(r *http.Request, slackSigningSecret string) (bool, error) {
+	if verifiedByClientDN(r) {
+		return true, nil
+	}
+
 	timeStamp := r.Header.Get(slackRequestTimestampHeader)
 	slackSignature := r.Header.Get(slackSignatureHeader)
 
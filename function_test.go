@@ -0,0 +1,41 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import "testing"
+
+func TestIsObjectRefQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		prefixes []string
+		want     bool
+	}{
+		{"T123", []string{"T", "t"}, true},
+		{"t123", []string{"T", "t"}, true},
+		{"test coverage", []string{"T", "t"}, false},
+		{"The login page", []string{"T", "t"}, false},
+		{"D42", []string{"D", "d"}, true},
+		{"deploy pipeline", []string{"D", "d"}, false},
+		{"P7", []string{"P", "p"}, true},
+		{"payment bug", []string{"P", "p"}, false},
+		{"T", []string{"T", "t"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isObjectRefQuery(tt.query, tt.prefixes...); got != tt.want {
+			t.Errorf("isObjectRefQuery(%q, %v) = %v, want %v", tt.query, tt.prefixes, got, tt.want)
+		}
+	}
+}
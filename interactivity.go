@@ -0,0 +1,250 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber/gonduit"
+	"github.com/uber/gonduit/core"
+)
+
+// interactionPayload mirrors the JSON Slack posts in the urlencoded
+// "payload" field of a block_actions interaction.
+// See https://api.slack.com/reference/interaction-payloads/block-actions.
+type interactionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// Interactivity handles Slack Block Kit interactions (button clicks,
+// pagination) posted to the /interactivity route and dispatches them to
+// the corresponding gonduit maniphest.edit transaction.
+func Interactivity(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+	setup(ctx)
+
+	var rf requestFields
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(ctx, w, rf, start, "Couldn't read request body", err)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	if r.Method != "POST" {
+		http.Error(w, "Only POST requests are accepted", 405)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(ctx, w, rf, start, "Couldn't parse form", err)
+		return
+	}
+
+	// Reset r.Body as ParseForm depletes it by reading the io.ReadCloser.
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	result, err := verifyWebHook(r, slackSecret)
+	if err != nil {
+		writeError(ctx, w, rf, start, "verifyWebHook failed", err)
+		return
+	}
+	if !result {
+		writeError(ctx, w, rf, start, "signatures did not match", nil)
+		return
+	}
+
+	if len(r.Form["payload"]) == 0 {
+		http.Error(w, "missing payload", 400)
+		return
+	}
+
+	var payload interactionPayload
+	if err := json.Unmarshal([]byte(r.Form["payload"][0]), &payload); err != nil {
+		writeError(ctx, w, rf, start, "json.Unmarshal(payload) failed", err)
+		return
+	}
+	rf.UserID = payload.User.ID
+
+	if len(payload.Actions) == 0 {
+		http.Error(w, "missing actions", 400)
+		return
+	}
+	rf.Command = payload.Actions[0].ActionID
+
+	res, err := dispatchAction(payload.Actions[0].ActionID, payload.Actions[0].Value, payload.User.ID)
+	if err != nil {
+		writeError(ctx, w, rf, start, "dispatchAction failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		logRequest(ctx, rf, time.Since(start), err)
+		return
+	}
+	logRequest(ctx, rf, time.Since(start), nil)
+}
+
+// dispatchAction runs the maniphest.edit (or search) call backing a
+// single Block Kit action and returns the message that should replace
+// the original one in Slack. slackUserID is the Slack account that
+// clicked the button, used by claimTask to resolve which Phabricator
+// account to assign to.
+func dispatchAction(actionID, value, slackUserID string) (*Message, error) {
+	client, err := gonduit.Dial(
+		"https://phabricator.sirclo.com",
+		&core.ClientOptions{
+			APIToken: phabAPIToken,
+			Client:   newRetryingClient(phabClientTimeout, defaultRetryConfig),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	switch actionID {
+	case actionCloseTask:
+		return closeTask(client, value)
+	case actionClaimTask:
+		return claimTask(client, value, slackUserID)
+	case actionNextPage:
+		parts := strings.SplitN(value, "\x1f", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed pagination value: %q", value)
+		}
+		return makeSearchRequestAfter(parts[0], parts[1])
+	default:
+		return nil, fmt.Errorf("unknown action_id: %s", actionID)
+	}
+}
+
+// maniphestEditRequest is the request body for maniphest.edit (no typed
+// wrapper in gonduit v0.6.1; see conduit.go). closeTask/claimTask go
+// through the generic Conn.Call.
+// See https://phabricator.sirclo.com/conduit/method/maniphest.edit/.
+type maniphestEditRequest struct {
+	ObjectIdentifier string                   `json:"objectIdentifier"`
+	Transactions     []map[string]interface{} `json:"transactions"`
+}
+
+// userWhoamiResponse is the subset of user.whoami's response this
+// package uses.
+type userWhoamiResponse struct {
+	PHID string `json:"phid"`
+}
+
+// maniphestEditResponse is the subset of maniphest.edit's response this
+// package uses; the transaction result itself is discarded.
+type maniphestEditResponse struct {
+	Object struct {
+		ID   int    `json:"id"`
+		PHID string `json:"phid"`
+	} `json:"object"`
+}
+
+// closeTask resolves maniphest task maniphestID via a "status"
+// transaction.
+func closeTask(client *gonduit.Conn, maniphestID string) (*Message, error) {
+	id, err := strconv.Atoi(maniphestID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := maniphestEditRequest{
+		ObjectIdentifier: fmt.Sprintf("T%d", id),
+		Transactions: []map[string]interface{}{
+			{"type": "status", "value": "resolved"},
+		},
+	}
+	var res maniphestEditResponse
+	if err := client.Call("maniphest.edit", req, &res); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("Closed https://phabricator.sirclo.com/T%d", id),
+	}, nil
+}
+
+// claimTask assigns maniphest task maniphestID to the Phabricator
+// account mapped to slackUserID via an "owner" transaction, falling
+// back to the account behind phabAPIToken (the bot) when slackUserID
+// has no mapping - see ownerPHIDFor.
+func claimTask(client *gonduit.Conn, maniphestID, slackUserID string) (*Message, error) {
+	id, err := strconv.Atoi(maniphestID)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerPHID, err := ownerPHIDFor(client, slackUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := maniphestEditRequest{
+		ObjectIdentifier: fmt.Sprintf("T%d", id),
+		Transactions: []map[string]interface{}{
+			{"type": "owner", "value": ownerPHID},
+		},
+	}
+	var res maniphestEditResponse
+	if err := client.Call("maniphest.edit", req, &res); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("Claimed https://phabricator.sirclo.com/T%d", id),
+	}, nil
+}
+
+// ownerPHIDFor resolves the Phabricator PHID that "Claim Task" should
+// assign to on slackUserID's behalf: its entry in SLACK_USER_PHID_MAP
+// (see loadUserPHIDMap) if one exists, otherwise the account behind
+// phabAPIToken, the same bot account claimTask always used before Slack
+// users could be mapped individually.
+func ownerPHIDFor(client *gonduit.Conn, slackUserID string) (string, error) {
+	mapping, err := loadUserPHIDMap()
+	if err != nil {
+		return "", err
+	}
+	if phid, ok := mapping[slackUserID]; ok {
+		return phid, nil
+	}
+
+	var who userWhoamiResponse
+	if err := client.Call("user.whoami", struct{}{}, &who); err != nil {
+		return "", err
+	}
+	return who.PHID, nil
+}
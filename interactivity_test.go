@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestOwnerPHIDForUsesMappingWhenPresent(t *testing.T) {
+	os.Setenv("SLACK_USER_PHID_MAP", `[{"slack_user_id":"U1","phabricator_phid":"PHID-USER-alice"}]`)
+	defer os.Unsetenv("SLACK_USER_PHID_MAP")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/conduit.getcapabilities" {
+			writeConduitResult(w, map[string]interface{}{
+				"authentication": []string{"token"},
+				"input":          []string{"urlencoded"},
+				"output":         []string{"json"},
+			})
+			return
+		}
+		t.Fatalf("unexpected request to %s; mapped users shouldn't fall back to user.whoami", r.URL.Path)
+	}))
+	defer server.Close()
+	client := dialFakeConn(t, server)
+
+	phid, err := ownerPHIDFor(client, "U1")
+	if err != nil {
+		t.Fatalf("ownerPHIDFor: %v", err)
+	}
+	if phid != "PHID-USER-alice" {
+		t.Errorf("ownerPHIDFor(U1) = %q, want PHID-USER-alice", phid)
+	}
+}
+
+func TestOwnerPHIDForFallsBackToBotWhenUnmapped(t *testing.T) {
+	os.Setenv("SLACK_USER_PHID_MAP", `[{"slack_user_id":"U1","phabricator_phid":"PHID-USER-alice"}]`)
+	defer os.Unsetenv("SLACK_USER_PHID_MAP")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		switch r.URL.Path {
+		case "/api/conduit.getcapabilities":
+			writeConduitResult(w, map[string]interface{}{
+				"authentication": []string{"token"},
+				"input":          []string{"urlencoded"},
+				"output":         []string{"json"},
+			})
+		case "/api/user.whoami":
+			writeConduitResult(w, map[string]interface{}{"phid": "PHID-USER-bot"})
+		default:
+			t.Fatalf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	client := dialFakeConn(t, server)
+
+	phid, err := ownerPHIDFor(client, "U2")
+	if err != nil {
+		t.Fatalf("ownerPHIDFor: %v", err)
+	}
+	if phid != "PHID-USER-bot" {
+		t.Errorf("ownerPHIDFor(U2) = %q, want PHID-USER-bot", phid)
+	}
+}
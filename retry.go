@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// phabClientTimeout bounds a single HTTP round trip to Phabricator,
+// including any retries performed by retryingTransport.
+const phabClientTimeout = 10 * time.Second
+
+// retryConfig controls retryingTransport's backoff behavior.
+type retryConfig struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// defaultRetryConfig is used for every gonduit.Dial call in this
+// package.
+var defaultRetryConfig = retryConfig{
+	MaxRetries: 3,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   5 * time.Second,
+}
+
+// newRetryingClient builds an *http.Client for gonduit.Dial that retries
+// Phabricator rate-limit (429) and server error (5xx) responses with
+// exponential backoff, bounded by timeout overall.
+func newRetryingClient(timeout time.Duration, cfg retryConfig) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &retryingTransport{base: http.DefaultTransport, config: cfg},
+	}
+}
+
+// retryingTransport is an http.RoundTripper that retries 429/5xx
+// responses with exponential backoff and jitter.
+type retryingTransport struct {
+	base   http.RoundTripper
+	config retryConfig
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var bodyBytes []byte
+	if req.Body != nil {
+		var err error
+		bodyBytes, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= t.config.MaxRetries; attempt++ {
+		if bodyBytes != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+		}
+
+		resp, err = t.base.RoundTrip(req)
+		if err != nil || !isRetryableStatus(resp.StatusCode) {
+			return resp, err
+		}
+
+		if attempt == t.config.MaxRetries {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		time.Sleep(t.backoff(attempt))
+	}
+
+	return resp, err
+}
+
+// isRetryableStatus reports whether code is a Phabricator rate-limit or
+// server error response worth retrying.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the delay before retry attempt, doubling each attempt
+// up to MaxDelay and adding jitter so concurrent retries don't collide.
+func (t *retryingTransport) backoff(attempt int) time.Duration {
+	delay := t.config.BaseDelay * time.Duration(int64(1)<<uint(attempt))
+	if delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
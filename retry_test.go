@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryingTransportRetriesOnTooManyRequests(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newRetryingClient(phabClientTimeout, retryConfig{
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("client.Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRetryingTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := newRetryingClient(phabClientTimeout, retryConfig{
+		MaxRetries: 2,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("client.Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3 (1 initial + 2 retries)", requests)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestRetryingTransportDoesNotRetryClientErrors(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := newRetryingClient(phabClientTimeout, defaultRetryConfig)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("client.Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1 (no retry on 404)", requests)
+	}
+}
+
+func TestBackoffGrowsAndCaps(t *testing.T) {
+	transport := &retryingTransport{config: retryConfig{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  300 * time.Millisecond,
+	}}
+
+	if d := transport.backoff(0); d > 100*time.Millisecond {
+		t.Errorf("backoff(0) = %v, want <= 100ms", d)
+	}
+	if d := transport.backoff(5); d > 300*time.Millisecond {
+		t.Errorf("backoff(5) = %v, want capped at 300ms", d)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uber/gonduit"
+	"github.com/uber/gonduit/entities"
+	"github.com/uber/gonduit/requests"
+)
+
+// statusColor maps a Phabricator object status to the Slack attachment
+// sidebar color it should be rendered with.
+func statusColor(status string) string {
+	switch strings.ToLower(status) {
+	case "open", "needsreview", "needs-review":
+		return "#4A90D9"
+	case "accepted":
+		return "#2E7D32"
+	case "rejected", "changes-planned":
+		return "#D9534F"
+	case "resolved", "closed", "abandoned":
+		return "#8E44AD"
+	default:
+		return "#CCCCCC"
+	}
+}
+
+// differentialRevisionSearchConstraints, ...Request and ...Response are
+// hand-rolled for differential.revision.search (no typed wrapper in
+// gonduit v0.6.1; see conduit.go). requestDifferentialDetail goes
+// through the generic Conn.Call.
+// See https://phabricator.sirclo.com/conduit/method/differential.revision.search/.
+type differentialRevisionSearchConstraints struct {
+	IDs []int `json:"ids,omitempty"`
+}
+
+type differentialRevisionSearchRequest struct {
+	Constraints *differentialRevisionSearchConstraints `json:"constraints,omitempty"`
+}
+
+type differentialRevisionSearchResponseItem struct {
+	ID     int    `json:"id"`
+	PHID   string `json:"phid"`
+	Fields struct {
+		Title  string `json:"title"`
+		Status struct {
+			Value string `json:"value"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+type differentialRevisionSearchResponse struct {
+	Data []differentialRevisionSearchResponseItem `json:"data"`
+}
+
+// requestDifferentialDetail looks up a single differential revision,
+// e.g. "D123".
+func requestDifferentialDetail(client *gonduit.Conn, query string) (*Message, error) {
+	revisionID, err := parseNumericID(query)
+	if err != nil {
+		return nil, err
+	}
+
+	req := differentialRevisionSearchRequest{
+		Constraints: &differentialRevisionSearchConstraints{
+			IDs: []int{revisionID},
+		},
+	}
+
+	var res differentialRevisionSearchResponse
+	if err := client.Call("differential.revision.search", req, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Data) <= 0 {
+		return notFoundMessage("Revision not found"), nil
+	}
+
+	d := res.Data[0]
+	link := fmt.Sprintf("https://phabricator.sirclo.com/D%d", revisionID)
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         link,
+		Attachments: []attachment{
+			{
+				Color:     statusColor(d.Fields.Status.Value),
+				Title:     d.Fields.Title,
+				TitleLink: link,
+				Fields: []fields{
+					{Title: "Status", Value: d.Fields.Status.Value, Short: false},
+				},
+			},
+		},
+	}, nil
+}
+
+// pasteSearchConstraints, ...Request and ...Response are hand-rolled
+// for paste.search (no typed wrapper in gonduit v0.6.1; see
+// conduit.go). requestPasteDetail goes through the generic Conn.Call.
+// See https://phabricator.sirclo.com/conduit/method/paste.search/.
+type pasteSearchConstraints struct {
+	IDs []int `json:"ids,omitempty"`
+}
+
+type pasteSearchRequest struct {
+	Constraints *pasteSearchConstraints `json:"constraints,omitempty"`
+}
+
+type pasteSearchResponseItem struct {
+	ID     int    `json:"id"`
+	PHID   string `json:"phid"`
+	Fields struct {
+		Title string `json:"title"`
+	} `json:"fields"`
+}
+
+type pasteSearchResponse struct {
+	Data []pasteSearchResponseItem `json:"data"`
+}
+
+// requestPasteDetail looks up a single paste, e.g. "P123".
+func requestPasteDetail(client *gonduit.Conn, query string) (*Message, error) {
+	pasteID, err := parseNumericID(query)
+	if err != nil {
+		return nil, err
+	}
+
+	req := pasteSearchRequest{
+		Constraints: &pasteSearchConstraints{
+			IDs: []int{pasteID},
+		},
+	}
+
+	var res pasteSearchResponse
+	if err := client.Call("paste.search", req, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Data) <= 0 {
+		return notFoundMessage("Paste not found"), nil
+	}
+
+	p := res.Data[0]
+	link := fmt.Sprintf("https://phabricator.sirclo.com/P%d", pasteID)
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         link,
+		Attachments: []attachment{
+			{
+				Title:     p.Fields.Title,
+				TitleLink: link,
+			},
+		},
+	}, nil
+}
+
+// userSearchConstraints, ...Request and ...Response are hand-rolled for
+// user.search (no typed wrapper in gonduit v0.6.1; see conduit.go).
+// requestUserLookup goes through the generic Conn.Call.
+// See https://phabricator.sirclo.com/conduit/method/user.search/.
+type userSearchConstraints struct {
+	Usernames []string `json:"usernames,omitempty"`
+}
+
+type userSearchRequest struct {
+	Constraints *userSearchConstraints `json:"constraints,omitempty"`
+}
+
+type userSearchResponseItem struct {
+	PHID   string `json:"phid"`
+	Fields struct {
+		RealName string `json:"realName"`
+	} `json:"fields"`
+}
+
+type userSearchResponse struct {
+	Data []userSearchResponseItem `json:"data"`
+}
+
+// requestUserLookup looks up a Phabricator user by username, e.g.
+// "@jdoe".
+func requestUserLookup(client *gonduit.Conn, query string) (*Message, error) {
+	username := strings.TrimPrefix(query, "@")
+	if username == "" {
+		return nil, fmt.Errorf("empty username in query %q", query)
+	}
+
+	req := userSearchRequest{
+		Constraints: &userSearchConstraints{
+			Usernames: []string{username},
+		},
+	}
+
+	var res userSearchResponse
+	if err := client.Call("user.search", req, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Data) <= 0 {
+		return notFoundMessage("User not found"), nil
+	}
+
+	u := res.Data[0]
+	link := fmt.Sprintf("https://phabricator.sirclo.com/p/%s/", username)
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         link,
+		Attachments: []attachment{
+			{
+				Title:     u.Fields.RealName,
+				TitleLink: link,
+			},
+		},
+	}, nil
+}
+
+// requestProjectLookup looks up a Phabricator project by tag slug, e.g.
+// "#frontend".
+func requestProjectLookup(client *gonduit.Conn, query string) (*Message, error) {
+	slug := strings.TrimPrefix(query, "#")
+	if slug == "" {
+		return nil, fmt.Errorf("empty project tag in query %q", query)
+	}
+
+	data, err := searchProjects(client, projectSearchConstraints{Slugs: []string{slug}})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) <= 0 {
+		return notFoundMessage("Project not found"), nil
+	}
+
+	p := data[0]
+	link := fmt.Sprintf("https://phabricator.sirclo.com/tag/%s/", slug)
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         link,
+		Attachments: []attachment{
+			{
+				Title:     p.Fields.Name,
+				TitleLink: link,
+			},
+		},
+	}, nil
+}
+
+// requestFulltextSearch is the fallback handler for queries that don't
+// match an object prefix: it runs a maniphest fulltext search and
+// paginates the results using Phabricator's "after" cursor, rendering a
+// "Next" button tied to the /interactivity route when more pages exist.
+func requestFulltextSearch(client *gonduit.Conn, query, after string) (*Message, error) {
+	req := requests.ManiphestSearchRequest{
+		Constraints: &requests.ManiphestSearchConstraints{
+			Query: query,
+		},
+	}
+	if after != "" {
+		afterCursor, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing pagination cursor %q: %v", after, err)
+		}
+		// Cursor is left nil rather than a zero-valued &entities.Cursor{}
+		// when there's no prior page: a present-but-zero "limit" is a
+		// real (empty) page size to maniphest.search, not "unset".
+		req.Cursor = &entities.Cursor{After: afterCursor}
+	}
+
+	res, err := client.ManiphestSearch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Data) <= 0 {
+		return notFoundMessage("No tasks matched your search"), nil
+	}
+
+	message := &Message{ResponseType: "in_channel", Text: fmt.Sprintf("Results for %q", query)}
+	for _, t := range res.Data {
+		link := fmt.Sprintf("https://phabricator.sirclo.com/T%d", t.ID)
+		message.Attachments = append(message.Attachments, attachment{
+			Color:     statusColor(t.Fields.Status.Value),
+			Title:     t.Fields.Name,
+			TitleLink: link,
+		})
+		message.Blocks = append(message.Blocks, newSectionBlock(fmt.Sprintf("<%s|%s>", link, t.Fields.Name)))
+	}
+
+	if res.Cursor.After != "" {
+		message.Blocks = append(message.Blocks, newPaginationBlock(query, res.Cursor.After))
+	}
+
+	return message, nil
+}
+
+// parseNumericID strips the leading object prefix letter (e.g. "D" in
+// "D123") and parses the remainder as an object ID.
+func parseNumericID(query string) (int, error) {
+	var id int
+	if _, err := fmt.Sscanf(query[1:], "%d", &id); err != nil {
+		return 0, fmt.Errorf("parsing id from %q: %v", query, err)
+	}
+	return id, nil
+}
+
+// notFoundMessage builds the standard "nothing matched" response used by
+// every search handler.
+func notFoundMessage(text string) *Message {
+	return &Message{
+		ResponseType: "in_channel",
+		Text:         text,
+		Attachments: []attachment{
+			{Text: "Please refine your search"},
+		},
+	}
+}
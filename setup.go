@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+var (
+	slackSecret   string
+	phabAPIToken  string
+	slackBotToken string
+	gcpProjectID  string
+	cloudLogger   *logging.Logger
+
+	setupOnce sync.Once
+)
+
+// setup lazily initializes the secrets and clients shared by every
+// invocation of F, Interactivity and SyncFeed. It is idempotent so it
+// is safe to call on every request.
+func setup(ctx context.Context) {
+	setupOnce.Do(func() {
+		slackSecret = os.Getenv("SLACK_SECRET")
+		phabAPIToken = os.Getenv("PHAB_API_TOKEN")
+		slackBotToken = os.Getenv("SLACK_BOT_TOKEN")
+
+		gcpProjectID = os.Getenv("GCP_PROJECT")
+		if gcpProjectID == "" {
+			return
+		}
+
+		client, err := logging.NewClient(ctx, gcpProjectID)
+		if err != nil {
+			log.Printf("logging.NewClient: %v", err)
+			return
+		}
+		cloudLogger = client.Logger("slackToPhabricator")
+	})
+}
+
+// requestFields are the request-scoped fields attached to every
+// structured log entry emitted for a single F or Interactivity
+// invocation.
+type requestFields struct {
+	UserID  string
+	TeamID  string
+	Command string
+	Query   string
+}
+
+// logRequest emits a structured log entry for one request, tagged with
+// rf and how long it took. If err is non-nil the entry is logged at
+// Error severity. Falls back to the standard logger when cloudLogger
+// hasn't been configured (e.g. running locally without GCP_PROJECT set).
+func logRequest(ctx context.Context, rf requestFields, latency time.Duration, err error) {
+	severity := logging.Info
+	if err != nil {
+		severity = logging.Error
+	}
+
+	payload := map[string]interface{}{
+		"slack_user_id": rf.UserID,
+		"slack_team_id": rf.TeamID,
+		"command":       rf.Command,
+		"query":         rf.Query,
+		"latency_ms":    latency.Milliseconds(),
+	}
+	if err != nil {
+		payload["error"] = err.Error()
+	}
+
+	if cloudLogger == nil {
+		log.Printf("%s %v", severity, payload)
+		return
+	}
+	cloudLogger.Log(logging.Entry{Severity: severity, Payload: payload})
+}
+
+// writeError logs msg (wrapping err, if any) with rf's request-scoped
+// fields and writes it back to Slack as an ephemeral message, rather
+// than killing the Cloud Function process the way log.Fatalf would.
+func writeError(ctx context.Context, w http.ResponseWriter, rf requestFields, start time.Time, msg string, err error) {
+	logErr := err
+	if logErr == nil {
+		logErr = errString(msg)
+	}
+	logRequest(ctx, rf, time.Since(start), logErr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&Message{
+		ResponseType: "ephemeral",
+		Text:         "Sorry, something went wrong handling that request.",
+	})
+}
+
+// errString turns a plain message into an error, used by writeError so
+// every failure - even ones without an underlying Go error - still
+// carries a non-empty "error" field in the structured log entry.
+type errString string
+
+func (e errString) Error() string { return string(e) }
@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watermarkCollection and watermarkDocument locate the single document
+// that stores SyncFeed's last-synced feed.query chronological key.
+const (
+	watermarkCollection = "slackToPhabricator"
+	watermarkDocument   = "feedWatermark"
+)
+
+// watermarkDoc is the Firestore document shape backing watermarkStore.
+type watermarkDoc struct {
+	ChronologicalKey string `firestore:"chronologicalKey"`
+}
+
+// watermarkStore persists SyncFeed's progress through the Phabricator
+// feed in Firestore, so a retried or re-scheduled invocation resumes
+// from the last successfully posted story instead of re-posting or
+// skipping any.
+type watermarkStore struct {
+	client *firestore.Client
+	doc    *firestore.DocumentRef
+}
+
+// newWatermarkStore dials Firestore for the given GCP project.
+func newWatermarkStore(ctx context.Context, projectID string) (*watermarkStore, error) {
+	client, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &watermarkStore{
+		client: client,
+		doc:    client.Collection(watermarkCollection).Doc(watermarkDocument),
+	}, nil
+}
+
+// Get returns the last chronological key SyncFeed successfully posted
+// through, or "" if no watermark has been recorded yet (e.g. the first
+// run).
+func (s *watermarkStore) Get(ctx context.Context) (string, error) {
+	snap, err := s.doc.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var wm watermarkDoc
+	if err := snap.DataTo(&wm); err != nil {
+		return "", err
+	}
+	return wm.ChronologicalKey, nil
+}
+
+// Advance records chronologicalKey as the new watermark. Callers must
+// only call this once the story at chronologicalKey has been fully
+// posted to Slack, so a Pub/Sub retry never re-delivers it.
+func (s *watermarkStore) Advance(ctx context.Context, chronologicalKey string) error {
+	_, err := s.doc.Set(ctx, watermarkDoc{ChronologicalKey: chronologicalKey})
+	return err
+}
+
+// Close releases the underlying Firestore client.
+func (s *watermarkStore) Close() error {
+	return s.client.Close()
+}